@@ -0,0 +1,101 @@
+// Package cipher implements the AES-256-CBC encryption scheme used by
+// Codeship Pro's `jet` CLI for `.encrypted` files, so that projects can be
+// decrypted and re-encrypted without shelling out to `jet` itself.
+//
+// On disk, a `.encrypted` file is base64-encoded ciphertext whose first 16
+// bytes (after base64-decoding) are the IV, followed by the PKCS#7-padded
+// ciphertext. The key is the 32-byte value Codeship hands back for a
+// project, itself base64-encoded in the `codeship.aes` file.
+package cipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+const blockSize = aes.BlockSize
+
+// Decrypt reverses jet's encryption: it base64-decodes ciphertext, splits
+// off the leading IV, CBC-decrypts the remainder with key, and strips the
+// PKCS#7 padding.
+func Decrypt(key, ciphertext []byte) ([]byte, error) {
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(ciphertext)))
+	n, err := base64.StdEncoding.Decode(raw, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode ciphertext: %s", err)
+	}
+	raw = raw[:n]
+
+	if len(raw) < blockSize {
+		return nil, fmt.Errorf("ciphertext too short to contain an IV")
+	}
+	iv, raw := raw[:blockSize], raw[blockSize:]
+
+	if len(raw)%blockSize != 0 {
+		return nil, fmt.Errorf("ciphertext is not a multiple of the block size")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %s", err)
+	}
+
+	plaintext := make([]byte, len(raw))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, raw)
+
+	return unpad(plaintext)
+}
+
+// Encrypt mirrors jet's encryption format: it pads plaintext to a multiple
+// of the AES block size with PKCS#7, generates a random IV, CBC-encrypts,
+// prepends the IV, and base64-encodes the result.
+func Encrypt(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %s", err)
+	}
+
+	padded := pad(plaintext, blockSize)
+
+	raw := make([]byte, blockSize+len(padded))
+	iv := raw[:blockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %s", err)
+	}
+
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(raw[blockSize:], padded)
+
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+	base64.StdEncoding.Encode(out, raw)
+
+	return out, nil
+}
+
+func pad(data []byte, size int) []byte {
+	padLen := size - len(data)%size
+	return append(data, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+}
+
+func unpad(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cannot unpad empty data")
+	}
+
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > len(data) || padLen > blockSize {
+		return nil, fmt.Errorf("invalid PKCS#7 padding")
+	}
+
+	for _, b := range data[len(data)-padLen:] {
+		if int(b) != padLen {
+			return nil, fmt.Errorf("invalid PKCS#7 padding")
+		}
+	}
+
+	return data[:len(data)-padLen], nil
+}
@@ -0,0 +1,101 @@
+// Package creds resolves credentials for Codeship, GitHub, and Bitbucket
+// from, in order of preference: an explicit value (a CLI flag or config.json
+// field), an environment variable, a ~/.netrc entry, and the OS keyring. It
+// also backs the `creds set`/`creds get`/`creds rm` subcommands that let
+// operators store tokens in the keyring once instead of exporting env vars
+// every time.
+package creds
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/zalando/go-keyring"
+)
+
+// ServiceName is the OS keyring service under which all credentials for
+// this tool are stored.
+const ServiceName = "codeship-rotate-aes"
+
+// NetrcField selects which field of a ~/.netrc machine entry to read.
+type NetrcField int
+
+const (
+	NetrcLogin NetrcField = iota
+	NetrcPassword
+)
+
+// Spec describes how to resolve a single credential.
+type Spec struct {
+	// Explicit is an already-resolved value (e.g. a CLI flag or a
+	// config.json field) that takes precedence over everything else.
+	Explicit string
+	// EnvVar is the environment variable to check next, if set.
+	EnvVar string
+	// NetrcMachine is the ~/.netrc "machine" entry to check next, if set.
+	NetrcMachine string
+	NetrcField   NetrcField
+	// KeyringKey is the keyring entry (under ServiceName) to check last,
+	// if set.
+	KeyringKey string
+}
+
+// Resolve returns the credential described by spec, consulting each source
+// in order and returning the first non-empty value found.
+func Resolve(spec Spec) (string, error) {
+	if spec.Explicit != "" {
+		return spec.Explicit, nil
+	}
+
+	if spec.EnvVar != "" {
+		if v := os.Getenv(spec.EnvVar); v != "" {
+			return v, nil
+		}
+	}
+
+	if spec.NetrcMachine != "" {
+		entry, ok, err := lookupNetrc(spec.NetrcMachine)
+		if err != nil {
+			return "", fmt.Errorf("failed to read ~/.netrc: %s", err)
+		}
+		if ok {
+			switch spec.NetrcField {
+			case NetrcPassword:
+				if entry.Password != "" {
+					return entry.Password, nil
+				}
+			default:
+				if entry.Login != "" {
+					return entry.Login, nil
+				}
+			}
+		}
+	}
+
+	if spec.KeyringKey != "" {
+		v, err := keyring.Get(ServiceName, spec.KeyringKey)
+		if err == nil {
+			return v, nil
+		}
+		if err != keyring.ErrNotFound {
+			return "", fmt.Errorf("failed to read %s from the OS keyring: %s", spec.KeyringKey, err)
+		}
+	}
+
+	return "", nil
+}
+
+// Set stores value under key in the OS keyring.
+func Set(key, value string) error {
+	return keyring.Set(ServiceName, key, value)
+}
+
+// Get returns the value stored under key in the OS keyring.
+func Get(key string) (string, error) {
+	return keyring.Get(ServiceName, key)
+}
+
+// Remove deletes the value stored under key in the OS keyring.
+func Remove(key string) error {
+	return keyring.Delete(ServiceName, key)
+}
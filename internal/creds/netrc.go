@@ -0,0 +1,107 @@
+package creds
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcEntry holds the login/password pair for one ~/.netrc machine.
+type netrcEntry struct {
+	Login    string
+	Password string
+}
+
+// lookupNetrc reads ~/.netrc and returns the entry for machine, if any.
+func lookupNetrc(machine string) (netrcEntry, bool, error) {
+	path, err := netrcPath()
+	if err != nil {
+		return netrcEntry{}, false, err
+	}
+
+	entries, err := parseNetrc(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return netrcEntry{}, false, nil
+		}
+		return netrcEntry{}, false, err
+	}
+
+	entry, ok := entries[machine]
+	return entry, ok, nil
+}
+
+func netrcPath() (string, error) {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// parseNetrc parses the machine/login/password tokens of a ~/.netrc file.
+// It ignores "default" and "macdef" entries, which this tool never needs.
+func parseNetrc(path string) (map[string]netrcEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := map[string]netrcEntry{}
+	var machine string
+	var entry netrcEntry
+
+	flush := func() {
+		if machine != "" {
+			entries[machine] = entry
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			flush()
+			machine = ""
+			entry = netrcEntry{}
+			if i+1 < len(tokens) {
+				i++
+				machine = tokens[i]
+			}
+		case "default", "macdef":
+			flush()
+			machine = ""
+			entry = netrcEntry{}
+		case "login":
+			if i+1 < len(tokens) {
+				i++
+				entry.Login = tokens[i]
+			}
+		case "password":
+			if i+1 < len(tokens) {
+				i++
+				entry.Password = tokens[i]
+			}
+		}
+	}
+	flush()
+
+	return entries, nil
+}
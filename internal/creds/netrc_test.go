@@ -0,0 +1,94 @@
+package creds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeNetrc(t *testing.T, contents string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".netrc")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("failed to write test .netrc: %s", err)
+	}
+	return path
+}
+
+func TestParseNetrc(t *testing.T) {
+	path := writeNetrc(t, `
+machine api.codeship.com
+  login alice
+  password s3cr3t
+
+machine github.com login bob password t0ken
+`)
+
+	entries, err := parseNetrc(path)
+	if err != nil {
+		t.Fatalf("parseNetrc returned error: %s", err)
+	}
+
+	if got := entries["api.codeship.com"]; got.Login != "alice" || got.Password != "s3cr3t" {
+		t.Fatalf("entries[api.codeship.com] = %+v, want alice/s3cr3t", got)
+	}
+	if got := entries["github.com"]; got.Login != "bob" || got.Password != "t0ken" {
+		t.Fatalf("entries[github.com] = %+v, want bob/t0ken", got)
+	}
+}
+
+func TestLookupNetrcMissingFile(t *testing.T) {
+	os.Setenv("NETRC", filepath.Join(t.TempDir(), "does-not-exist"))
+	defer os.Unsetenv("NETRC")
+
+	_, ok, err := lookupNetrc("api.codeship.com")
+	if err != nil {
+		t.Fatalf("lookupNetrc returned error: %s", err)
+	}
+	if ok {
+		t.Fatal("expected ok=false for a missing .netrc file")
+	}
+}
+
+func TestResolvePrefersExplicitOverEverything(t *testing.T) {
+	os.Setenv("SOME_ENV_VAR", "from-env")
+	defer os.Unsetenv("SOME_ENV_VAR")
+
+	v, err := Resolve(Spec{Explicit: "from-flag", EnvVar: "SOME_ENV_VAR"})
+	if err != nil {
+		t.Fatalf("Resolve returned error: %s", err)
+	}
+	if v != "from-flag" {
+		t.Fatalf("Resolve() = %q, want %q", v, "from-flag")
+	}
+}
+
+func TestResolveFallsBackToEnvVar(t *testing.T) {
+	os.Setenv("SOME_ENV_VAR", "from-env")
+	defer os.Unsetenv("SOME_ENV_VAR")
+
+	v, err := Resolve(Spec{EnvVar: "SOME_ENV_VAR"})
+	if err != nil {
+		t.Fatalf("Resolve returned error: %s", err)
+	}
+	if v != "from-env" {
+		t.Fatalf("Resolve() = %q, want %q", v, "from-env")
+	}
+}
+
+func TestResolveFallsBackToNetrc(t *testing.T) {
+	path := writeNetrc(t, "machine api.codeship.com login alice password s3cr3t\n")
+	os.Setenv("NETRC", path)
+	defer os.Unsetenv("NETRC")
+
+	v, err := Resolve(Spec{NetrcMachine: "api.codeship.com", NetrcField: NetrcPassword})
+	if err != nil {
+		t.Fatalf("Resolve returned error: %s", err)
+	}
+	if v != "s3cr3t" {
+		t.Fatalf("Resolve() = %q, want %q", v, "s3cr3t")
+	}
+}
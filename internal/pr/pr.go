@@ -0,0 +1,175 @@
+// Package pr opens pull requests against GitHub and Bitbucket once a
+// rotated project's branch has been pushed, so operators no longer have to
+// click through a printed URL for every repo.
+package pr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Request describes the pull request to open for a single project.
+type Request struct {
+	// Owner is the GitHub org/user or Bitbucket workspace.
+	Owner string
+	// Repo is the repository or repo slug name.
+	Repo string
+	// Title and Body are the templated PR title/description.
+	Title string
+	Body  string
+	// Head is the branch containing the rotated changes.
+	Head string
+	// Base is the branch the PR should merge into.
+	Base string
+}
+
+// Opener opens a pull request for a project and returns its URL.
+type Opener interface {
+	Open(req Request) (string, error)
+}
+
+// GitHubOpener opens pull requests via the GitHub REST API.
+type GitHubOpener struct {
+	Token      string
+	HTTPClient *http.Client
+
+	// baseURL overrides the GitHub API host in tests; left empty in
+	// production so requests go to the real API.
+	baseURL string
+}
+
+// NewGitHubOpener returns a GitHubOpener authenticated with token.
+func NewGitHubOpener(token string) *GitHubOpener {
+	return &GitHubOpener{Token: token, HTTPClient: http.DefaultClient}
+}
+
+func (o *GitHubOpener) Open(req Request) (string, error) {
+	base := o.baseURL
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls", base, req.Owner, req.Repo)
+
+	body, err := json.Marshal(map[string]string{
+		"title": req.Title,
+		"body":  req.Body,
+		"head":  req.Head,
+		"base":  req.Base,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal GitHub PR request: %s", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build GitHub PR request: %s", err)
+	}
+	httpReq.Header.Set("Authorization", "token "+o.Token)
+	httpReq.Header.Set("Accept", "application/vnd.github+json")
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to open GitHub PR for %s/%s: %s", req.Owner, req.Repo, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("GitHub PR creation for %s/%s failed with status %s: %s", req.Owner, req.Repo, resp.Status, respBody)
+	}
+
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse GitHub PR response for %s/%s: %s", req.Owner, req.Repo, err)
+	}
+
+	return result.HTMLURL, nil
+}
+
+// BitbucketOpener opens pull requests via the Bitbucket Cloud REST API.
+type BitbucketOpener struct {
+	AppPassword string
+	Username    string
+	HTTPClient  *http.Client
+
+	// baseURL overrides the Bitbucket API host in tests; left empty in
+	// production so requests go to the real API.
+	baseURL string
+}
+
+// NewBitbucketOpener returns a BitbucketOpener authenticated with
+// username/appPassword (a Bitbucket app password, not the account password).
+func NewBitbucketOpener(username, appPassword string) *BitbucketOpener {
+	return &BitbucketOpener{Username: username, AppPassword: appPassword, HTTPClient: http.DefaultClient}
+}
+
+func (o *BitbucketOpener) Open(req Request) (string, error) {
+	base := o.baseURL
+	if base == "" {
+		base = "https://api.bitbucket.org"
+	}
+	url := fmt.Sprintf("%s/2.0/repositories/%s/%s/pullrequests", base, req.Owner, req.Repo)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"title":       req.Title,
+		"description": req.Body,
+		"source": map[string]interface{}{
+			"branch": map[string]string{"name": req.Head},
+		},
+		"destination": map[string]interface{}{
+			"branch": map[string]string{"name": req.Base},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Bitbucket PR request: %s", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build Bitbucket PR request: %s", err)
+	}
+	httpReq.SetBasicAuth(o.Username, o.AppPassword)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to open Bitbucket PR for %s/%s: %s", req.Owner, req.Repo, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("Bitbucket PR creation for %s/%s failed with status %s: %s", req.Owner, req.Repo, resp.Status, respBody)
+	}
+
+	var result struct {
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse Bitbucket PR response for %s/%s: %s", req.Owner, req.Repo, err)
+	}
+
+	return result.Links.HTML.Href, nil
+}
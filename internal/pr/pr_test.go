@@ -0,0 +1,115 @@
+package pr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitHubOpenerOpen(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody map[string]string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("failed to decode request body: %s", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url": "https://github.com/acme/widgets/pull/1"}`))
+	}))
+	defer srv.Close()
+
+	o := NewGitHubOpener("t0ken")
+	o.HTTPClient = srv.Client()
+	o.baseURL = srv.URL
+
+	url, err := o.Open(Request{Owner: "acme", Repo: "widgets", Title: "rotate", Body: "rotated secrets", Head: "rotate-creds", Base: "main"})
+	if err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	if url != "https://github.com/acme/widgets/pull/1" {
+		t.Fatalf("Open() = %q, want the html_url from the response", url)
+	}
+	if gotPath != "/repos/acme/widgets/pulls" {
+		t.Fatalf("request path = %q, want /repos/acme/widgets/pulls", gotPath)
+	}
+	if gotAuth != "token t0ken" {
+		t.Fatalf("Authorization header = %q, want %q", gotAuth, "token t0ken")
+	}
+	if gotBody["title"] != "rotate" || gotBody["body"] != "rotated secrets" || gotBody["head"] != "rotate-creds" || gotBody["base"] != "main" {
+		t.Fatalf("request body = %+v, want the Request fields", gotBody)
+	}
+}
+
+func TestGitHubOpenerOpenNon201(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message": "Validation Failed"}`))
+	}))
+	defer srv.Close()
+
+	o := NewGitHubOpener("t0ken")
+	o.HTTPClient = srv.Client()
+	o.baseURL = srv.URL
+
+	if _, err := o.Open(Request{Owner: "acme", Repo: "widgets"}); err == nil {
+		t.Fatal("expected an error for a non-201 response")
+	}
+}
+
+func TestBitbucketOpenerOpen(t *testing.T) {
+	var gotPath, gotUser, gotPass string
+	var ok bool
+	var gotBody map[string]interface{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotUser, gotPass, ok = r.BasicAuth()
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("failed to decode request body: %s", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"links": {"html": {"href": "https://bitbucket.org/acme/widgets/pull-requests/1"}}}`))
+	}))
+	defer srv.Close()
+
+	o := NewBitbucketOpener("alice", "app-pw")
+	o.HTTPClient = srv.Client()
+	o.baseURL = srv.URL
+
+	url, err := o.Open(Request{Owner: "acme", Repo: "widgets", Title: "rotate", Body: "rotated secrets", Head: "rotate-creds", Base: "main"})
+	if err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	if url != "https://bitbucket.org/acme/widgets/pull-requests/1" {
+		t.Fatalf("Open() = %q, want the html href from the response", url)
+	}
+	if gotPath != "/2.0/repositories/acme/widgets/pullrequests" {
+		t.Fatalf("request path = %q, want /2.0/repositories/acme/widgets/pullrequests", gotPath)
+	}
+	if !ok || gotUser != "alice" || gotPass != "app-pw" {
+		t.Fatalf("basic auth = %q/%q (ok=%v), want alice/app-pw", gotUser, gotPass, ok)
+	}
+	if gotBody["title"] != "rotate" || gotBody["description"] != "rotated secrets" {
+		t.Fatalf("request body = %+v, want title/description from the Request", gotBody)
+	}
+}
+
+func TestBitbucketOpenerOpenNon201(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"message": "unauthorized"}}`))
+	}))
+	defer srv.Close()
+
+	o := NewBitbucketOpener("alice", "wrong-pw")
+	o.HTTPClient = srv.Client()
+	o.baseURL = srv.URL
+
+	if _, err := o.Open(Request{Owner: "acme", Repo: "widgets"}); err == nil {
+		t.Fatal("expected an error for a non-201 response")
+	}
+}
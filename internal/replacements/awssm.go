@@ -0,0 +1,52 @@
+package replacements
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// AWSSecretsManagerSource fetches the replacement map from a secret stored
+// as a JSON object of string key/value pairs in AWS Secrets Manager.
+type AWSSecretsManagerSource struct {
+	Region     string
+	SecretName string
+	client     secretsmanageriface.SecretsManagerAPI
+}
+
+// NewAWSSecretsManagerSource returns an AWSSecretsManagerSource for
+// secretName in region, using the ambient AWS credential chain.
+func NewAWSSecretsManagerSource(region, secretName string) *AWSSecretsManagerSource {
+	return &AWSSecretsManagerSource{Region: region, SecretName: secretName}
+}
+
+// Fetch implements Source.
+func (a *AWSSecretsManagerSource) Fetch(ctx context.Context) (map[string]string, error) {
+	client := a.client
+	if client == nil {
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(a.Region)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS session: %s", err)
+		}
+		client = secretsmanager.New(sess)
+	}
+
+	result, err := client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(a.SecretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch AWS secret %s: %s", a.SecretName, err)
+	}
+
+	var out map[string]string
+	if err := json.Unmarshal([]byte(aws.StringValue(result.SecretString)), &out); err != nil {
+		return nil, fmt.Errorf("failed to parse AWS secret %s as a JSON string map: %s", a.SecretName, err)
+	}
+
+	return out, nil
+}
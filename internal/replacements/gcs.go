@@ -0,0 +1,68 @@
+package replacements
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"cloud.google.com/go/storage"
+)
+
+// objectReader is the subset of the storage client GCSSource needs, so
+// tests can substitute a mock without real GCS credentials.
+type objectReader interface {
+	ReadObject(ctx context.Context, bucket, key string) ([]byte, error)
+}
+
+// GCSSource fetches the replacement map from a JSON object in GCS.
+type GCSSource struct {
+	Bucket string
+	Key    string
+	reader objectReader
+}
+
+// NewGCSSource returns a GCSSource for bucket/key, using the ambient GCP
+// application-default credentials.
+func NewGCSSource(bucket, key string) *GCSSource {
+	return &GCSSource{Bucket: bucket, Key: key}
+}
+
+// Fetch implements Source.
+func (g *GCSSource) Fetch(ctx context.Context) (map[string]string, error) {
+	reader := g.reader
+	if reader == nil {
+		reader = gcsClientReader{}
+	}
+
+	data, err := reader.ReadObject(ctx, g.Bucket, g.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gs://%s/%s: %s", g.Bucket, g.Key, err)
+	}
+
+	var out map[string]string
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse gs://%s/%s as a JSON string map: %s", g.Bucket, g.Key, err)
+	}
+
+	return out, nil
+}
+
+// gcsClientReader is the default objectReader, backed by a real GCS client.
+type gcsClientReader struct{}
+
+func (gcsClientReader) ReadObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %s", err)
+	}
+	defer client.Close()
+
+	r, err := client.Bucket(bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
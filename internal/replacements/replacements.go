@@ -0,0 +1,113 @@
+// Package replacements resolves the map of find/replace secrets used to
+// rotate credentials in decrypted files. Rather than requiring the map to
+// be embedded in plaintext in config.json, it can be fetched at runtime
+// from Vault, AWS Secrets Manager, or a GCS/S3 object, dispatched by a
+// `scheme://` source string much like blob-storage tools dispatch on
+// `gs://` vs `s3://`.
+package replacements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Source fetches the current find/replace map for a rotation run.
+type Source interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// Inline is a Source that just returns a fixed map, preserving the original
+// behavior of embedding replacements directly in config.json.
+type Inline struct {
+	Replacements map[string]string
+}
+
+// Fetch implements Source.
+func (i Inline) Fetch(ctx context.Context) (map[string]string, error) {
+	return i.Replacements, nil
+}
+
+// New resolves a source string (e.g. "vault://secret/data/codeship",
+// "awssm://us-east-1/codeship-replacements", "gs://bucket/key",
+// "s3://bucket/key") into the Source that knows how to fetch it. An empty
+// source string is not valid here; callers should fall back to Inline
+// themselves when no source is configured.
+func New(source string) (Source, error) {
+	scheme, rest, ok := strings.Cut(source, "://")
+	if !ok {
+		return nil, fmt.Errorf("replacements source %q is missing a scheme (expected e.g. vault://, awssm://, gs://, s3://)", source)
+	}
+
+	switch scheme {
+	case "vault":
+		return NewVaultSource(rest), nil
+	case "awssm":
+		region, secretName, ok := strings.Cut(rest, "/")
+		if !ok {
+			return nil, fmt.Errorf("awssm source %q must be of the form awssm://region/secret-name", source)
+		}
+		return NewAWSSecretsManagerSource(region, secretName), nil
+	case "gs":
+		bucket, key, ok := strings.Cut(rest, "/")
+		if !ok {
+			return nil, fmt.Errorf("gs source %q must be of the form gs://bucket/key", source)
+		}
+		return NewGCSSource(bucket, key), nil
+	case "s3":
+		bucket, key, ok := strings.Cut(rest, "/")
+		if !ok {
+			return nil, fmt.Errorf("s3 source %q must be of the form s3://bucket/key", source)
+		}
+		return NewS3Source(bucket, key), nil
+	default:
+		return nil, fmt.Errorf("unsupported replacements source scheme %q", scheme)
+	}
+}
+
+// ProjectSource pairs a project-name regex with the source string to use
+// when it matches. Entries are checked in order, so callers must preserve
+// the order the operator declared them in (e.g. by decoding them from a
+// JSON array rather than an object).
+type ProjectSource struct {
+	Pattern string `json:"pattern"`
+	Source  string `json:"source"`
+}
+
+// ErrNoSourceConfigured is returned by ForProject when projectName matches
+// none of byProject and defaultSource is empty. Callers should treat this
+// as "use the inline config.Replacements map" rather than a hard failure.
+var ErrNoSourceConfigured = errors.New("no replacements source configured")
+
+// ForProject resolves the Source to use for a given project name, checking
+// byProject (in order, first match wins) before falling back to
+// defaultSource. If nothing matches and defaultSource is empty, it returns
+// ErrNoSourceConfigured so the caller can fall back to its own Inline
+// source.
+func ForProject(projectName, defaultSource string, byProject []ProjectSource) (Source, error) {
+	for _, entry := range byProject {
+		matched, err := matchProject(entry.Pattern, projectName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replacements_source_by_project pattern %q: %s", entry.Pattern, err)
+		}
+		if matched {
+			return New(entry.Source)
+		}
+	}
+
+	if defaultSource == "" {
+		return nil, ErrNoSourceConfigured
+	}
+
+	return New(defaultSource)
+}
+
+func matchProject(pattern, projectName string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(projectName), nil
+}
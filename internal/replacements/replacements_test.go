@@ -0,0 +1,143 @@
+package replacements
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type mockSource struct {
+	data map[string]string
+	err  error
+}
+
+func (m mockSource) Fetch(ctx context.Context) (map[string]string, error) {
+	return m.data, m.err
+}
+
+func TestInlineFetch(t *testing.T) {
+	src := Inline{Replacements: map[string]string{"find": "replace"}}
+
+	got, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch returned error: %s", err)
+	}
+	if got["find"] != "replace" {
+		t.Fatalf("Fetch() = %v, want map with find=replace", got)
+	}
+}
+
+func TestNewDispatchesByScheme(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{"vault://secret/data/codeship", false},
+		{"awssm://us-east-1/codeship-replacements", false},
+		{"awssm://us-east-1", true},
+		{"gs://my-bucket/codeship.json", false},
+		{"gs://my-bucket", true},
+		{"s3://my-bucket/codeship.json", false},
+		{"ftp://nope", true},
+		{"no-scheme-at-all", true},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.source)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("New(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+		}
+	}
+}
+
+func TestForProjectPrefersProjectOverride(t *testing.T) {
+	src, err := ForProject("acme/widgets", "vault://secret/data/default", []ProjectSource{
+		{Pattern: "^acme/widgets$", Source: "vault://secret/data/widgets"},
+	})
+	if err != nil {
+		t.Fatalf("ForProject returned error: %s", err)
+	}
+
+	vaultSrc, ok := src.(*VaultSource)
+	if !ok {
+		t.Fatalf("ForProject returned %T, want *VaultSource", src)
+	}
+	if vaultSrc.Path != "secret/data/widgets" {
+		t.Fatalf("ForProject used path %q, want the per-project override", vaultSrc.Path)
+	}
+}
+
+func TestForProjectFirstMatchWins(t *testing.T) {
+	// Both patterns match "acme/widgets"; order must be honored
+	// deterministically rather than picked by map iteration.
+	src, err := ForProject("acme/widgets", "", []ProjectSource{
+		{Pattern: "^acme/widgets$", Source: "vault://secret/data/first"},
+		{Pattern: "^acme/.*$", Source: "vault://secret/data/second"},
+	})
+	if err != nil {
+		t.Fatalf("ForProject returned error: %s", err)
+	}
+
+	vaultSrc, ok := src.(*VaultSource)
+	if !ok {
+		t.Fatalf("ForProject returned %T, want *VaultSource", src)
+	}
+	if vaultSrc.Path != "secret/data/first" {
+		t.Fatalf("ForProject used path %q, want the first matching entry", vaultSrc.Path)
+	}
+}
+
+func TestForProjectFallsBackToDefault(t *testing.T) {
+	src, err := ForProject("acme/other", "vault://secret/data/default", []ProjectSource{
+		{Pattern: "^acme/widgets$", Source: "vault://secret/data/widgets"},
+	})
+	if err != nil {
+		t.Fatalf("ForProject returned error: %s", err)
+	}
+
+	vaultSrc, ok := src.(*VaultSource)
+	if !ok {
+		t.Fatalf("ForProject returned %T, want *VaultSource", src)
+	}
+	if vaultSrc.Path != "secret/data/default" {
+		t.Fatalf("ForProject used path %q, want the default source", vaultSrc.Path)
+	}
+}
+
+func TestForProjectNoSourceConfiguredReturnsSentinel(t *testing.T) {
+	_, err := ForProject("acme/other", "", nil)
+	if !errors.Is(err, ErrNoSourceConfigured) {
+		t.Fatalf("ForProject() error = %v, want ErrNoSourceConfigured", err)
+	}
+}
+
+func TestVaultSourceFlattensKVv2Data(t *testing.T) {
+	data, err := flattenSecretData(map[string]interface{}{
+		"data": map[string]interface{}{
+			"find": "replace",
+		},
+	})
+	if err != nil {
+		t.Fatalf("flattenSecretData returned error: %s", err)
+	}
+	if data["find"] != "replace" {
+		t.Fatalf("flattenSecretData() = %v, want map with find=replace", data)
+	}
+}
+
+func TestVaultSourceFlattenRejectsNonStringValues(t *testing.T) {
+	if _, err := flattenSecretData(map[string]interface{}{"find": 1}); err == nil {
+		t.Fatal("expected an error for a non-string secret value")
+	}
+}
+
+func TestMockSourceSatisfiesSource(t *testing.T) {
+	var src Source = mockSource{data: map[string]string{"a": "b"}}
+	got, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch returned error: %s", err)
+	}
+	if got["a"] != "b" {
+		t.Fatalf("Fetch() = %v, want map with a=b", got)
+	}
+}
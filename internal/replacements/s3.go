@@ -0,0 +1,59 @@
+package replacements
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// S3Source fetches the replacement map from a JSON object in S3.
+type S3Source struct {
+	Bucket string
+	Key    string
+	client s3iface.S3API
+}
+
+// NewS3Source returns an S3Source for bucket/key, using the ambient AWS
+// credential chain.
+func NewS3Source(bucket, key string) *S3Source {
+	return &S3Source{Bucket: bucket, Key: key}
+}
+
+// Fetch implements Source.
+func (s *S3Source) Fetch(ctx context.Context) (map[string]string, error) {
+	client := s.client
+	if client == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS session: %s", err)
+		}
+		client = s3.New(sess)
+	}
+
+	result, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %s", s.Bucket, s.Key, err)
+	}
+	defer result.Body.Close()
+
+	data, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %s", s.Bucket, s.Key, err)
+	}
+
+	var out map[string]string
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse s3://%s/%s as a JSON string map: %s", s.Bucket, s.Key, err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,66 @@
+package replacements
+
+import (
+	"context"
+	"fmt"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// secretReader is the subset of *vaultapi.Logical that VaultSource needs,
+// so tests can substitute a mock without a running Vault server.
+type secretReader interface {
+	ReadWithContext(ctx context.Context, path string) (*vaultapi.Secret, error)
+}
+
+// VaultSource fetches the replacement map from a Vault KV secret.
+type VaultSource struct {
+	Path   string
+	reader secretReader
+}
+
+// NewVaultSource returns a VaultSource reading from path, using the
+// ambient Vault environment (VAULT_ADDR, VAULT_TOKEN, etc.) for auth.
+func NewVaultSource(path string) *VaultSource {
+	return &VaultSource{Path: path}
+}
+
+// Fetch implements Source.
+func (v *VaultSource) Fetch(ctx context.Context) (map[string]string, error) {
+	reader := v.reader
+	if reader == nil {
+		client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Vault client: %s", err)
+		}
+		reader = client.Logical()
+	}
+
+	secret, err := reader.ReadWithContext(ctx, v.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault secret %s: %s", v.Path, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no Vault secret found at %s", v.Path)
+	}
+
+	return flattenSecretData(secret.Data)
+}
+
+// flattenSecretData coerces a Vault secret's Data map (or its nested
+// "data" field, for KV v2 engines) into a map[string]string.
+func flattenSecretData(data map[string]interface{}) (map[string]string, error) {
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	out := make(map[string]string, len(data))
+	for k, v := range data {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("secret field %q is not a string", k)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
@@ -3,37 +3,79 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/codeship/codeship-go"
+	"github.com/fillup/codeship-rotate-aes/internal/cipher"
+	"github.com/fillup/codeship-rotate-aes/internal/creds"
+	"github.com/fillup/codeship-rotate-aes/internal/pr"
+	"github.com/fillup/codeship-rotate-aes/internal/replacements"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gogithttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gogitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 )
 
 var changeCounts = map[string]map[string]int{}
 var DefaultMaxProjectsPerRun = 20
 var prURLS []string
+var stateMu sync.Mutex
+
+var useJet = flag.Bool("use-jet", false, "shell out to the jet CLI for encrypt/decrypt instead of the built-in AES implementation")
+var noPR = flag.Bool("no-pr", false, "don't open pull requests automatically, just print the compare URL like before")
+var concurrency = flag.Int("concurrency", 1, "number of projects to rotate in parallel")
+var gitBinary = flag.String("git-binary", "", "path to a git binary to shell out to for clone/commit/push, instead of the built-in go-git implementation (needed for LFS or submodules)")
+
+var codeshipUsernameFlag = flag.String("codeship-username", "", "Codeship username (overrides env var, ~/.netrc, and the OS keyring)")
+var codeshipPasswordFlag = flag.String("codeship-password", "", "Codeship password (overrides env var, ~/.netrc, and the OS keyring)")
+var githubTokenFlag = flag.String("github-token", "", "GitHub token (overrides config.json, env var, ~/.netrc, and the OS keyring)")
+var bitbucketUsernameFlag = flag.String("bitbucket-username", "", "Bitbucket username (overrides config.json, env var, ~/.netrc, and the OS keyring)")
+var bitbucketAppPasswordFlag = flag.String("bitbucket-app-password", "", "Bitbucket app password (overrides config.json, env var, ~/.netrc, and the OS keyring)")
 
 type Config struct {
-	EncryptedFilePatterns                    []string          `json:"encrypted_file_patterns"`
-	Replacements                             map[string]string `json:"replacements"`
-	CheckoutBranch                           string            `json:"checkout_branch"`
-	PushBranch                               string            `json:"push_branch"`
-	MaxProjectsPerRun                        int               `json:"max_projects_per_run"`
-	RepoFilterPatterns                       []string          `json:"repo_filter_patterns"`
-	ResetKeysInProjectsWithoutEncryptedFiles bool              `json:"reset_keys_in_projects_without_encrypted_files"`
+	EncryptedFilePatterns                    []string                     `json:"encrypted_file_patterns"`
+	Replacements                             map[string]string            `json:"replacements"`
+	CheckoutBranch                           string                       `json:"checkout_branch"`
+	PushBranch                               string                       `json:"push_branch"`
+	MaxProjectsPerRun                        int                          `json:"max_projects_per_run"`
+	RepoFilterPatterns                       []string                     `json:"repo_filter_patterns"`
+	ResetKeysInProjectsWithoutEncryptedFiles bool                         `json:"reset_keys_in_projects_without_encrypted_files"`
+	GitHubToken                              string                       `json:"github_token"`
+	BitbucketUsername                        string                       `json:"bitbucket_username"`
+	BitbucketAppPassword                     string                       `json:"bitbucket_app_password"`
+	ReplacementsSource                       string                       `json:"replacements_source"`
+	ReplacementsSourceByProject              []replacements.ProjectSource `json:"replacements_source_by_project"`
+	GitUserName                              string                       `json:"git_user_name"`
+	GitUserEmail                             string                       `json:"git_user_email"`
 }
 
 var config Config
 var emptyConfig = Config{EncryptedFilePatterns: []string{""}, Replacements: map[string]string{"find": "replace"}, RepoFilterPatterns: []string{}}
 
 func init() {
+	// the creds subcommand manages secrets independent of config.json and
+	// must work before one exists, so skip loading (and template-creating)
+	// config.json entirely when it's what's being run.
+	if len(os.Args) > 1 && os.Args[1] == "creds" {
+		return
+	}
+
 	// load config file or create a template file if config.json doesn't exist
 	data, err := ioutil.ReadFile("config.json")
 	if err != nil {
@@ -61,7 +103,68 @@ func init() {
 }
 
 func main() {
-	auth := codeship.NewBasicAuth(os.Getenv("CODESHIP_USERNAME"), os.Getenv("CODESHIP_PASSWORD"))
+	if len(os.Args) > 1 && os.Args[1] == "creds" {
+		if err := runCredsCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	flag.Parse()
+
+	codeshipUsername, err := creds.Resolve(creds.Spec{
+		Explicit:     *codeshipUsernameFlag,
+		EnvVar:       "CODESHIP_USERNAME",
+		NetrcMachine: "api.codeship.com",
+		NetrcField:   creds.NetrcLogin,
+		KeyringKey:   "codeship-username",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	codeshipPassword, err := creds.Resolve(creds.Spec{
+		Explicit:     *codeshipPasswordFlag,
+		EnvVar:       "CODESHIP_PASSWORD",
+		NetrcMachine: "api.codeship.com",
+		NetrcField:   creds.NetrcPassword,
+		KeyringKey:   "codeship-password",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config.GitHubToken, err = creds.Resolve(creds.Spec{
+		Explicit:     firstNonEmpty(*githubTokenFlag, config.GitHubToken),
+		EnvVar:       "GITHUB_TOKEN",
+		NetrcMachine: "github.com",
+		NetrcField:   creds.NetrcPassword,
+		KeyringKey:   "github-token",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.BitbucketUsername, err = creds.Resolve(creds.Spec{
+		Explicit:     firstNonEmpty(*bitbucketUsernameFlag, config.BitbucketUsername),
+		EnvVar:       "BITBUCKET_USERNAME",
+		NetrcMachine: "bitbucket.org",
+		NetrcField:   creds.NetrcLogin,
+		KeyringKey:   "bitbucket-username",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.BitbucketAppPassword, err = creds.Resolve(creds.Spec{
+		Explicit:     firstNonEmpty(*bitbucketAppPasswordFlag, config.BitbucketAppPassword),
+		EnvVar:       "BITBUCKET_TOKEN",
+		NetrcMachine: "bitbucket.org",
+		NetrcField:   creds.NetrcPassword,
+		KeyringKey:   "bitbucket-app-password",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auth := codeship.NewBasicAuth(codeshipUsername, codeshipPassword)
 	client, err := codeship.New(auth)
 	if err != nil {
 		log.Fatal(err)
@@ -160,148 +263,239 @@ loop:
 		log.Fatalf("unable to get current working directory: %s", err)
 	}
 
+	if *concurrency < 1 {
+		log.Fatalf("--concurrency must be >= 1, got %d", *concurrency)
+	}
+
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+
 	for i, p := range allProjects {
-		fmt.Printf("\n\n--------------------------------------------------------\n")
-		fmt.Printf("Starting project #%v - %s\n", i+1, p.Name)
-		changeCounts[p.Name] = map[string]int{}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, p codeship.Project) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			processProject(ctx, org, wd, i, p)
+		}(i, p)
+	}
 
-		if err := os.Chdir(wd); err != nil {
-			log.Fatalf("unable to change back to main working directory %s, error: %s", wd, err)
-		}
+	wg.Wait()
 
-		folder, err := cloneProject(p)
-		if err != nil {
-			fmt.Printf("ALERT!!!! failed to clone project so it was not processed, fix it manually: %s\n", err)
-			continue
-		}
-		fmt.Printf("Project cloned into %s\n", folder)
+	fmt.Printf("\n\nall projects complete, now go create some PRs:\n")
+	for _, url := range prURLS {
+		fmt.Println(url)
+	}
 
-		if err := os.Chdir(folder); err != nil {
-			fmt.Printf("ALERT!!!! failed to change dir into project %s so it was not processed, fix it manually: %s\n", folder, err)
-			continue
+	fmt.Printf("\n\nChange counts by project and file:\n")
+	for projectName, data := range changeCounts {
+		fmt.Printf("  %s:\n", projectName)
+		for file, count := range data {
+			fmt.Printf("    %s - %v\n", file, count)
 		}
+	}
 
-		encFiles := findEncryptedFiles(getFileList("."), config.EncryptedFilePatterns)
-		if len(encFiles) == 0 {
-			fmt.Printf("no encrypted files found for project %s\n", p.Name)
-		} else {
-			fmt.Printf("found encrypted files: \n%s\n", strings.Join(encFiles, "\n"))
-		}
+	fmt.Printf("adios amigo\n")
+}
 
-		if len(encFiles) == 0 && !config.ResetKeysInProjectsWithoutEncryptedFiles {
-			fmt.Printf("since no encrypted files were found, will not rotate key, proceeding to next project...\n")
-			if err := addCompletedProject(p.Name); err != nil {
-				fmt.Printf("failed to add project to completed projects file: %s", err)
-			}
+// processProject rotates the AES key for a single project: clone, decrypt
+// and replace secrets in any encrypted files, reset the key on Codeship,
+// re-encrypt, push a branch, and open a PR. It never changes the process's
+// working directory, so it's safe to run concurrently across projects.
+func processProject(ctx context.Context, org *codeship.Organization, wd string, i int, p codeship.Project) {
+	logf := func(format string, args ...interface{}) {
+		fmt.Printf("[%s] "+format, append([]interface{}{p.Name}, args...)...)
+	}
 
-			if err := removeFolder(folder); err != nil {
-				fmt.Println(err.Error())
-			}
-			continue
-		}
+	logf("\n\n--------------------------------------------------------\n")
+	logf("Starting project #%v - %s\n", i+1, p.Name)
 
-		var aesFile string
-		if len(encFiles) > 0 {
-			aesFile, err = createAESFile(".", p.AesKey)
-			if err != nil {
-				fmt.Printf("failed to create AES file %s for project %s, error: %s\n", aesFile, p.Name, err)
-			}
+	dir, err := cloneProject(wd, p, logf)
+	if err != nil {
+		logf("ALERT!!!! failed to clone project so it was not processed, fix it manually: %s\n", err)
+		return
+	}
+	logf("Project cloned into %s\n", dir)
 
-			for _, file := range encFiles {
-				if err := decryptFile(file, aesFile); err != nil {
-					fmt.Printf("failed to decrypt %s, error: %s\n", file, err)
-					if err := cleanupFolder("."); err != nil {
-						fmt.Printf("%s", err)
-					}
-					continue
-				}
+	files, err := getFileList(dir)
+	if err != nil {
+		logf("failed to list files for project %s, error: %s\n", p.Name, err)
+		return
+	}
+	encFiles := findEncryptedFiles(files, config.EncryptedFilePatterns)
+	if len(encFiles) == 0 {
+		logf("no encrypted files found for project %s\n", p.Name)
+	} else {
+		logf("found encrypted files: \n%s\n", strings.Join(encFiles, "\n"))
+	}
 
-				if err := replaceSecretsInFile(file+".decrypted", config.Replacements, p.Name); err != nil {
-					fmt.Printf("failed to replace secrets in file %s, error: %s\n", file, err)
-					if err := cleanupFolder("."); err != nil {
-						fmt.Printf("%s", err)
-					}
-					continue
-				}
-			}
+	if len(encFiles) == 0 && !config.ResetKeysInProjectsWithoutEncryptedFiles {
+		logf("since no encrypted files were found, will not rotate key, proceeding to next project...\n")
+		markProjectCompleted(p.Name)
+
+		if err := removeFolder(dir); err != nil {
+			logf("%s\n", err.Error())
 		}
+		return
+	}
 
-		updated, _, err := org.ResetProjectAESKey(ctx, p.UUID)
+	counts := map[string]int{}
+
+	var aesFile string
+	if len(encFiles) > 0 {
+		aesFile, err = createAESFile(dir, p.AesKey, logf)
 		if err != nil {
-			fmt.Printf("failed to reset AES key for project %s on Codeship: %s\n", p.Name, err)
-			if err := cleanupFolder(folder); err != nil {
-				fmt.Printf("%s", err)
+			logf("failed to create AES file %s for project %s, error: %s\n", aesFile, p.Name, err)
+		}
+
+		replacementsMap, err := resolveReplacements(ctx, p.Name)
+		if err != nil {
+			logf("failed to resolve replacements for project %s, error: %s\n", p.Name, err)
+			if err := cleanupFolder(dir, logf); err != nil {
+				logf("%s", err)
 			}
-			continue
+			return
 		}
 
-		if len(encFiles) > 0 {
-			if err := removeFile(aesFile); err != nil {
-				fmt.Printf("unable to delete previous aes file after resetting project aes key: %s\n", err)
-				fmt.Printf("UH OH!!!, manual intervention required. you'll need to decrypt files with old key (%s) and renecrypt with new key (%s)\n", p.AesKey, updated.AesKey)
+		for _, file := range encFiles {
+			if err := decryptFile(dir, file, aesFile, logf); err != nil {
+				logf("failed to decrypt %s, error: %s\n", file, err)
+				if err := cleanupFolder(dir, logf); err != nil {
+					logf("%s", err)
+				}
 				continue
 			}
 
-			updatedAesFile, err := createAESFile(".", updated.AesKey)
+			matches, err := replaceSecretsInFile(filepath.Join(dir, file+".decrypted"), replacementsMap)
 			if err != nil {
-				fmt.Printf("failed to create updated AES file %s for project %s, error: %s\n", updatedAesFile, p.Name, err)
-			}
-
-			for _, file := range encFiles {
-				if err := encryptFile(file, aesFile); err != nil {
-					fmt.Printf("failed to encrypt %s, error: %s\n", file, err)
+				logf("failed to replace secrets in file %s, error: %s\n", file, err)
+				if err := cleanupFolder(dir, logf); err != nil {
+					logf("%s", err)
 				}
-			}
-
-			if err := cleanupFolder("."); err != nil {
-				fmt.Printf("ALERT: unable to cleanup folder before pushing branch, WONT PUSH AUTOMATICALY!!!%s\n", err)
 				continue
 			}
+			counts[file] = matches
+		}
+	}
 
-			if err := commitAndPushNewBranch(); err != nil {
-				fmt.Printf("got an error in commit and push process, YOU PROBABLY NEED TO PUSH MANUALLY!!!: %s\n", err)
-			}
+	updated, _, err := org.ResetProjectAESKey(ctx, p.UUID)
+	if err != nil {
+		logf("failed to reset AES key for project %s on Codeship: %s\n", p.Name, err)
+		if err := cleanupFolder(dir, logf); err != nil {
+			logf("%s", err)
+		}
+		return
+	}
 
-			prURLS = append(prURLS, getPRURL(p.RepositoryURL, p.Name))
+	if len(encFiles) > 0 {
+		if err := removeFile(aesFile); err != nil {
+			logf("unable to delete previous aes file after resetting project aes key: %s\n", err)
+			logf("UH OH!!!, manual intervention required. you'll need to decrypt files with old key (%s) and renecrypt with new key (%s)\n", p.AesKey, updated.AesKey)
+			return
 		}
 
-		if err := os.Chdir(".."); err != nil {
-			log.Fatalf("Unable to change directory up a level, error: %s", err)
+		updatedAesFile, err := createAESFile(dir, updated.AesKey, logf)
+		if err != nil {
+			logf("failed to create updated AES file %s for project %s, error: %s\n", updatedAesFile, p.Name, err)
 		}
 
-		if err := addCompletedProject(p.Name); err != nil {
-			fmt.Printf("failed to add project to completed projects file: %s", err)
+		for _, file := range encFiles {
+			if err := encryptFile(dir, file, aesFile, logf); err != nil {
+				logf("failed to encrypt %s, error: %s\n", file, err)
+			}
 		}
 
-		if err := removeFolder(folder); err != nil {
-			fmt.Println(err.Error())
+		if err := cleanupFolder(dir, logf); err != nil {
+			logf("ALERT: unable to cleanup folder before pushing branch, WONT PUSH AUTOMATICALY!!!%s\n", err)
+			return
 		}
 
-		fmt.Printf("\n\nFinished process for %s project!!!\n", p.Name)
-		fmt.Printf("--------------------------------------------------------\n")
+		if err := commitAndPushNewBranch(dir, p, logf); err != nil {
+			logf("got an error in commit and push process, YOU PROBABLY NEED TO PUSH MANUALLY!!!: %s\n", err)
+		}
+
+		var url string
+		if *noPR {
+			url = getPRURL(p.RepositoryURL, p.Name)
+		} else {
+			url, err = openPullRequest(p, counts, encFiles)
+			if err != nil {
+				logf("failed to open pull request for %s, falling back to a compare URL: %s\n", p.Name, err)
+				url = getPRURL(p.RepositoryURL, p.Name)
+			}
+		}
+
+		stateMu.Lock()
+		prURLS = append(prURLS, url)
+		stateMu.Unlock()
 	}
 
-	fmt.Printf("\n\nall projects complete, now go create some PRs:\n")
-	for _, url := range prURLS {
-		fmt.Println(url)
+	stateMu.Lock()
+	changeCounts[p.Name] = counts
+	stateMu.Unlock()
+
+	markProjectCompleted(p.Name)
+
+	if err := removeFolder(dir); err != nil {
+		logf("%s\n", err.Error())
 	}
 
-	fmt.Printf("\n\nChange counts by project and file:\n")
-	for projectName, data := range changeCounts {
-		fmt.Printf("  %s:\n", projectName)
-		for file, count := range data {
-			fmt.Printf("    %s - %v\n", file, count)
+	logf("\n\nFinished process for %s project!!!\n", p.Name)
+	logf("--------------------------------------------------------\n")
+}
+
+// markProjectCompleted records a project as done, serializing writes to
+// completed-projects.txt across concurrent projects.
+func markProjectCompleted(name string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if err := addCompletedProject(name); err != nil {
+		fmt.Printf("failed to add project to completed projects file: %s", err)
+	}
+}
+
+// cloneProject clones project into baseDir and returns the full path to the
+// resulting checkout. It never changes the process's working directory, so
+// it's safe to call from multiple goroutines. By default it clones with
+// go-git; pass --git-binary to shell out to a git binary instead, for
+// environments that need LFS or submodule support go-git doesn't cover.
+func cloneProject(baseDir string, project codeship.Project, logf func(string, ...interface{})) (string, error) {
+	if *gitBinary != "" {
+		return cloneProjectWithBinary(baseDir, project, *gitBinary, logf)
+	}
+
+	auth, cloneUrl, err := gitAuthForProject(project)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(baseDir, cloneDirName(project))
+	logf("Preparing to clone %s into %s...\n", cloneUrl, dir)
+
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{URL: cloneUrl, Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to clone repo %s, error: %s", cloneUrl, err)
+	}
+
+	if config.CheckoutBranch != "" {
+		wt, err := repo.Worktree()
+		if err != nil {
+			return "", fmt.Errorf("failed to open worktree for %s, error: %s", dir, err)
+		}
+		if err := wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(config.CheckoutBranch)}); err != nil {
+			return "", fmt.Errorf("failed to checkout branch %s, error: %s", config.CheckoutBranch, err)
 		}
 	}
 
-	fmt.Printf("adios amigo\n")
+	return dir, nil
 }
 
-func cloneProject(project codeship.Project) (string, error) {
+// cloneProjectWithBinary is the shell-out fallback used when --git-binary is set.
+func cloneProjectWithBinary(baseDir string, project codeship.Project, binary string, logf func(string, ...interface{})) (string, error) {
 	cloneUrl := getGitCloneUrl(project)
-	folder := getFolderName(project)
-	fmt.Printf("Preparing to clone %s into %s...\n", cloneUrl, folder)
-	cmd := exec.Command("git", "clone", cloneUrl)
+	dir := filepath.Join(baseDir, cloneDirName(project))
+	logf("Preparing to clone %s into %s...\n", cloneUrl, dir)
+	cmd := exec.Command(binary, "-C", baseDir, "clone", cloneUrl, dir)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &out
@@ -309,12 +503,8 @@ func cloneProject(project codeship.Project) (string, error) {
 		return "", fmt.Errorf("failed to clone repo %s, error: %s, output: %s", cloneUrl, err, out.String())
 	}
 
-	if err := os.Chdir(folder); err != nil {
-		return "", fmt.Errorf("failed to change dir into %s after clone, error: %s", folder, err)
-	}
-
 	if config.CheckoutBranch != "" {
-		cmd2 := exec.Command("git", "checkout", config.CheckoutBranch)
+		cmd2 := exec.Command(binary, "-C", dir, "checkout", config.CheckoutBranch)
 		var out2 bytes.Buffer
 		cmd2.Stdout = &out2
 		cmd2.Stderr = &out2
@@ -323,14 +513,65 @@ func cloneProject(project codeship.Project) (string, error) {
 		}
 	}
 
-	if err := os.Chdir(".."); err != nil {
-		return "", fmt.Errorf("failed to change dir up a level after branch checkout, error: %s", err)
+	return dir, nil
+}
+
+// commitAndPushNewBranch stages the rotated *.encrypted files in dir, commits
+// them, and pushes. By default it uses go-git; pass --git-binary to shell
+// out to a git binary instead.
+func commitAndPushNewBranch(dir string, p codeship.Project, logf func(string, ...interface{})) error {
+	if *gitBinary != "" {
+		return commitAndPushNewBranchWithBinary(dir, *gitBinary, logf)
+	}
+
+	branch := config.CheckoutBranch
+	if config.PushBranch != "" {
+		branch = config.PushBranch
 	}
 
-	return folder, nil
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo at %s, error: %s", dir, err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open worktree at %s, error: %s", dir, err)
+	}
+
+	if config.PushBranch != "" {
+		if err := wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(config.PushBranch), Create: true}); err != nil {
+			return fmt.Errorf("failed to checkout new branch %s, error: %s", config.PushBranch, err)
+		}
+	}
+
+	if err := wt.AddGlob("*.encrypted"); err != nil {
+		return fmt.Errorf("failed to add encrypted files, branch: %s, error: %s", branch, err)
+	}
+	if _, err := wt.Commit("updated encrypted files with rotated credentials", &git.CommitOptions{Author: gitSignature()}); err != nil {
+		return fmt.Errorf("failed to commit changes, branch: %s, error: %s", branch, err)
+	}
+
+	auth, _, err := gitAuthForProject(p)
+	if err != nil {
+		return fmt.Errorf("failed to resolve git auth to push, branch: %s, error: %s", branch, err)
+	}
+
+	pushOpts := &git.PushOptions{Auth: auth}
+	if config.PushBranch != "" {
+		refSpec := fmt.Sprintf("refs/heads/%s:refs/heads/%s", config.PushBranch, config.PushBranch)
+		pushOpts.RefSpecs = []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)}
+	}
+	if err := repo.Push(pushOpts); err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to push new branch, branch: %s, error: %s", branch, err)
+	}
+
+	logf("push process completed successfully for branch %s\n", branch)
+	return nil
 }
 
-func commitAndPushNewBranch() error {
+// commitAndPushNewBranchWithBinary is the shell-out fallback used when
+// --git-binary is set.
+func commitAndPushNewBranchWithBinary(dir string, binary string, logf func(string, ...interface{})) error {
 	type command struct {
 		name    string
 		command *exec.Cmd
@@ -341,29 +582,29 @@ func commitAndPushNewBranch() error {
 	if config.PushBranch != "" {
 		commands = append(commands, command{
 			name:    "checkout new branch",
-			command: exec.Command("git", "checkout", "-b", config.PushBranch),
+			command: exec.Command(binary, "-C", dir, "checkout", "-b", config.PushBranch),
 		})
 	}
 
 	commands = append(commands,
 		command{
 			name:    "add encrypted files",
-			command: exec.Command("git", "add", "*.encrypted"),
+			command: exec.Command(binary, "-C", dir, "add", "*.encrypted"),
 		},
 		command{
 			name:    "commit changes",
-			command: exec.Command("git", "commit", "-m", "updated encrypted files with rotated credentials"),
+			command: exec.Command(binary, "-C", dir, "commit", "-m", "updated encrypted files with rotated credentials"),
 		})
 
 	if config.PushBranch != "" {
 		commands = append(commands, command{
 			name:    "push new branch",
-			command: exec.Command("git", "push", "-u", "origin", config.PushBranch),
+			command: exec.Command(binary, "-C", dir, "push", "-u", "origin", config.PushBranch),
 		})
 	} else {
 		commands = append(commands, command{
 			name:    "push changes",
-			command: exec.Command("git", "push"),
+			command: exec.Command(binary, "-C", dir, "push"),
 		})
 	}
 
@@ -378,12 +619,73 @@ func commitAndPushNewBranch() error {
 			}
 			return fmt.Errorf("failed to %s, branch: %s, error: %s, output: %s", cmd.name, branch, err, out.String())
 		}
-		fmt.Printf("push process command %s executed successfully\n", cmd.name)
+		logf("push process command %s executed successfully\n", cmd.name)
 	}
 
 	return nil
 }
 
+// gitSignature returns the author/committer identity used for rotation
+// commits, falling back to a generic identity if config.json doesn't set one.
+func gitSignature() *object.Signature {
+	name := config.GitUserName
+	if name == "" {
+		name = "codeship-rotate-aes"
+	}
+	email := config.GitUserEmail
+	if email == "" {
+		email = "codeship-rotate-aes@localhost"
+	}
+	return &object.Signature{Name: name, Email: email, When: time.Now()}
+}
+
+// gitAuthForProject picks go-git auth for project, preferring HTTPS with a
+// configured GitHub token or Bitbucket app password and falling back to SSH
+// (via a running ssh-agent, or ~/.ssh/id_rsa) when no token is configured.
+// It returns the matching clone URL for whichever auth method it picked.
+func gitAuthForProject(p codeship.Project) (transport.AuthMethod, string, error) {
+	switch strings.ToLower(p.RepositoryProvider) {
+	case "github":
+		if config.GitHubToken != "" {
+			return httpsAuth("x-access-token", config.GitHubToken), fmt.Sprintf("https://github.com/%s.git", p.Name), nil
+		}
+	case "bitbucket":
+		if config.BitbucketAppPassword != "" {
+			username := config.BitbucketUsername
+			if username == "" {
+				username = "x-token-auth"
+			}
+			return httpsAuth(username, config.BitbucketAppPassword), fmt.Sprintf("https://bitbucket.org/%s.git", p.Name), nil
+		}
+	}
+
+	auth, err := sshAuth()
+	if err != nil {
+		return nil, "", fmt.Errorf("no HTTPS token is configured for %s and no SSH key could be loaded: %s", p.Name, err)
+	}
+	return auth, getGitCloneUrl(p), nil
+}
+
+func httpsAuth(username, password string) transport.AuthMethod {
+	return &gogithttp.BasicAuth{Username: username, Password: password}
+}
+
+// sshAuth returns go-git SSH auth, preferring a running ssh-agent
+// (SSH_AUTH_SOCK) and falling back to the default key at ~/.ssh/id_rsa.
+func sshAuth() (transport.AuthMethod, error) {
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		if auth, err := gogitssh.NewSSHAgentAuth("git"); err == nil {
+			return auth, nil
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate home directory for ~/.ssh/id_rsa: %s", err)
+	}
+	return gogitssh.NewPublicKeysFromFile("git", filepath.Join(home, ".ssh", "id_rsa"), "")
+}
+
 func getGitCloneUrl(project codeship.Project) string {
 	var domain string
 	switch strings.ToLower(project.RepositoryProvider) {
@@ -400,6 +702,66 @@ func getGitCloneUrl(project codeship.Project) string {
 	return fmt.Sprintf("git@%s:%s.git", domain, project.Name)
 }
 
+// openPullRequest opens a real pull request for project p via the GitHub or
+// Bitbucket API, using the files changed and their replacement counts to
+// fill out the PR body.
+func openPullRequest(p codeship.Project, counts map[string]int, changedFiles []string) (string, error) {
+	opener, err := pullRequestOpenerFor(p)
+	if err != nil {
+		return "", err
+	}
+
+	base := config.CheckoutBranch
+	if base == "" {
+		base = "master"
+	}
+	head := config.PushBranch
+	if head == "" {
+		head = "develop"
+	}
+
+	req := pr.Request{
+		Owner: strings.Split(p.Name, "/")[0],
+		Repo:  getFolderName(p),
+		Title: "Rotate AES-encrypted credentials",
+		Body:  buildPRBody(counts, changedFiles),
+		Head:  head,
+		Base:  base,
+	}
+
+	return opener.Open(req)
+}
+
+// pullRequestOpenerFor returns the pr.Opener for project p's repository
+// provider, based on the credentials configured for it.
+func pullRequestOpenerFor(p codeship.Project) (pr.Opener, error) {
+	switch strings.ToLower(p.RepositoryProvider) {
+	case "github":
+		if config.GitHubToken == "" {
+			return nil, fmt.Errorf("no GitHub token configured (set github_token in config.json or GITHUB_TOKEN)")
+		}
+		return pr.NewGitHubOpener(config.GitHubToken), nil
+	case "bitbucket":
+		if config.BitbucketAppPassword == "" {
+			return nil, fmt.Errorf("no Bitbucket app password configured (set bitbucket_app_password in config.json or BITBUCKET_TOKEN)")
+		}
+		return pr.NewBitbucketOpener(config.BitbucketUsername, config.BitbucketAppPassword), nil
+	default:
+		return nil, fmt.Errorf("unsupported repository provider %q", p.RepositoryProvider)
+	}
+}
+
+// buildPRBody renders a templated pull request description listing the
+// files changed and their per-file replacement counts.
+func buildPRBody(counts map[string]int, changedFiles []string) string {
+	var body strings.Builder
+	body.WriteString("Automated credential rotation.\n\nFiles changed:\n")
+	for _, file := range changedFiles {
+		body.WriteString(fmt.Sprintf("- %s (%d replacements)\n", file, counts[file]))
+	}
+	return body.String()
+}
+
 func getPRURL(repoURL, projectName string) string {
 	if strings.Contains(repoURL, "bitbucket") {
 		return fmt.Sprintf("https://bitbucket.org/%s/pull-requests/new?source=develop&t=1", projectName)
@@ -415,10 +777,19 @@ func getFolderName(project codeship.Project) string {
 	return parts[1]
 }
 
-func getFileList(folder string) []string {
+// cloneDirName returns the directory name to clone project into, derived
+// from its full "owner/repo" project name rather than just the trailing
+// repo name. With --concurrency > 1, projects from different owners or
+// providers that happen to share a repo name would otherwise race to clone
+// into the same directory.
+func cloneDirName(project codeship.Project) string {
+	return strings.ReplaceAll(project.Name, "/", "-")
+}
+
+func getFileList(folder string) ([]string, error) {
 	files, err := ioutil.ReadDir(folder)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to list files in %s, error: %s", folder, err)
 	}
 
 	onlyFiles := []string{}
@@ -430,7 +801,7 @@ func getFileList(folder string) []string {
 		onlyFiles = append(onlyFiles, file.Name())
 	}
 
-	return onlyFiles
+	return onlyFiles, nil
 }
 
 func findEncryptedFiles(files []string, patterns []string) []string {
@@ -446,45 +817,132 @@ func findEncryptedFiles(files []string, patterns []string) []string {
 	return encFiles
 }
 
-func createAESFile(folder, key string) (string, error) {
+func createAESFile(folder, key string, logf func(string, ...interface{})) (string, error) {
 	if folder == "" {
 		folder = "."
 	}
 	filename := fmt.Sprintf("%s/%s", folder, "codeship.aes")
-	fmt.Printf("creating AES key file: %s\n", filename)
+	logf("creating AES key file: %s\n", filename)
 	return filename, ioutil.WriteFile(filename, []byte(key), 06400)
 }
 
-func decryptFile(file, keyFile string) error {
-	fmt.Printf("Decrypting %s to %s.decrypted ...", file, file)
-	cmd := exec.Command("jet", "decrypt", "--key-path", keyFile, file, file+".decrypted")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to decrypt %s, error: %s, output: %s", file, err, out.String())
+// decryptFile decrypts dir/file into dir/file.decrypted using keyFile (a
+// full path to a codeship.aes file, as returned by createAESFile).
+func decryptFile(dir, file, keyFile string, logf func(string, ...interface{})) error {
+	fullFile := filepath.Join(dir, file)
+	logf("Decrypting %s to %s.decrypted ...", fullFile, fullFile)
+
+	if *useJet {
+		cmd := exec.Command("jet", "decrypt", "--key-path", keyFile, fullFile, fullFile+".decrypted")
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to decrypt %s, error: %s, output: %s", fullFile, err, out.String())
+		}
+		logf("done\n")
+		return nil
+	}
+
+	key, err := readAESKeyFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s, error: %s", fullFile, err)
 	}
-	fmt.Printf("done\n")
+
+	ciphertext, err := ioutil.ReadFile(fullFile)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s, error: %s", fullFile, err)
+	}
+
+	plaintext, err := cipher.Decrypt(key, ciphertext)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s, error: %s", fullFile, err)
+	}
+
+	if err := ioutil.WriteFile(fullFile+".decrypted", plaintext, 0600); err != nil {
+		return fmt.Errorf("failed to decrypt %s, error: %s", fullFile, err)
+	}
+	logf("done\n")
 
 	return nil
 }
 
-func encryptFile(file, keyFile string) error {
-	fmt.Printf("Encrypting %s.decrypted to %s ...", file, file)
-	cmd := exec.Command("jet", "encrypt", "--key-path", keyFile, file+".decrypted", file)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to encrypt %s, error: %s, output: %s", file, err, out.String())
+// encryptFile encrypts dir/file.decrypted back into dir/file using keyFile
+// (a full path to a codeship.aes file, as returned by createAESFile).
+func encryptFile(dir, file, keyFile string, logf func(string, ...interface{})) error {
+	fullFile := filepath.Join(dir, file)
+	logf("Encrypting %s.decrypted to %s ...", fullFile, fullFile)
+
+	if *useJet {
+		cmd := exec.Command("jet", "encrypt", "--key-path", keyFile, fullFile+".decrypted", fullFile)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to encrypt %s, error: %s, output: %s", fullFile, err, out.String())
+		}
+		logf("done\n")
+		return nil
+	}
+
+	key, err := readAESKeyFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s, error: %s", fullFile, err)
 	}
-	fmt.Printf("done\n")
+
+	plaintext, err := ioutil.ReadFile(fullFile + ".decrypted")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s, error: %s", fullFile, err)
+	}
+
+	ciphertext, err := cipher.Encrypt(key, plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s, error: %s", fullFile, err)
+	}
+
+	if err := ioutil.WriteFile(fullFile, ciphertext, 0600); err != nil {
+		return fmt.Errorf("failed to encrypt %s, error: %s", fullFile, err)
+	}
+	logf("done\n")
 
 	return nil
 }
 
-func replaceSecretsInFile(file string, replacements map[string]string, projectName string) error {
+// readAESKeyFile reads the base64-encoded AES key Codeship writes to a
+// project's codeship.aes file and returns the decoded key bytes.
+func readAESKeyFile(keyFile string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %s", keyFile, err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode key file %s: %s", keyFile, err)
+	}
+
+	return key, nil
+}
+
+// resolveReplacements fetches the find/replace map to use for projectName,
+// preferring a per-project replacements source, then the configured
+// default source, then falling back to the inline config.Replacements map.
+func resolveReplacements(ctx context.Context, projectName string) (map[string]string, error) {
+	source, err := replacements.ForProject(projectName, config.ReplacementsSource, config.ReplacementsSourceByProject)
+	if errors.Is(err, replacements.ErrNoSourceConfigured) {
+		return config.Replacements, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return source.Fetch(ctx)
+}
+
+// replaceSecretsInFile rewrites file in place with each key in replacements
+// swapped for its value, returning how many of the keys were found.
+func replaceSecretsInFile(file string, replacements map[string]string) (int, error) {
 	contents, err := ioutil.ReadFile(file)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	strconts := string(contents)
@@ -494,10 +952,9 @@ func replaceSecretsInFile(file string, replacements map[string]string, projectNa
 			matches++
 		}
 		strconts = strings.Replace(strconts, key, val, -1)
-		changeCounts[projectName][file] = matches
 	}
 	fmt.Printf("Replaced %v strings in %s\n", matches, file)
-	return ioutil.WriteFile(file, []byte(strconts), 06400)
+	return matches, ioutil.WriteFile(file, []byte(strconts), 06400)
 }
 
 func removeFile(file string) error {
@@ -519,21 +976,24 @@ func removeFolder(folder string) error {
 	return nil
 }
 
-func cleanupFolder(folder string) error {
+func cleanupFolder(folder string, logf func(string, ...interface{})) error {
 	// remove codeship.aes
 	if err := removeFile(folder + "/codeship.aes"); err != nil {
 		return err
 	}
-	fmt.Printf("deleted %s/codeship.aes\n", folder)
+	logf("deleted %s/codeship.aes\n", folder)
 
 	// remove any .decrypted files
-	files := getFileList(folder)
+	files, err := getFileList(folder)
+	if err != nil {
+		return err
+	}
 	for _, filename := range files {
 		if strings.HasSuffix(filename, "decrypted") {
 			if err := removeFile(folder + "/" + filename); err != nil {
 				return err
 			}
-			fmt.Printf("deleted %s/%s\n", folder, filename)
+			logf("deleted %s/%s\n", folder, filename)
 		}
 	}
 	return nil
@@ -571,3 +1031,64 @@ func isStringInSlice(needle string, haystack []string) bool {
 
 	return false
 }
+
+// firstNonEmpty returns the first non-empty string in vals, or "" if all
+// are empty.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// credsKeys are the keyring entries operators can manage via `creds
+// set`/`creds get`/`creds rm`.
+var credsKeys = []string{
+	"codeship-username",
+	"codeship-password",
+	"github-token",
+	"bitbucket-username",
+	"bitbucket-app-password",
+}
+
+// runCredsCommand implements the `creds set|get|rm <key> [value]`
+// subcommands for storing rotator credentials in the OS keyring.
+func runCredsCommand(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: creds <set|get|rm> <%s> [value]", strings.Join(credsKeys, "|"))
+	}
+
+	action, key := args[0], args[1]
+	if !isStringInSlice(key, credsKeys) {
+		return fmt.Errorf("unknown creds key %q, must be one of: %s", key, strings.Join(credsKeys, ", "))
+	}
+
+	switch action {
+	case "set":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: creds set <%s> <value>", strings.Join(credsKeys, "|"))
+		}
+		if err := creds.Set(key, args[2]); err != nil {
+			return fmt.Errorf("failed to store %s in the OS keyring: %s", key, err)
+		}
+		fmt.Printf("stored %s in the OS keyring\n", key)
+		return nil
+	case "get":
+		v, err := creds.Get(key)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from the OS keyring: %s", key, err)
+		}
+		fmt.Println(v)
+		return nil
+	case "rm":
+		if err := creds.Remove(key); err != nil {
+			return fmt.Errorf("failed to remove %s from the OS keyring: %s", key, err)
+		}
+		fmt.Printf("removed %s from the OS keyring\n", key)
+		return nil
+	default:
+		return fmt.Errorf("unknown creds action %q, must be one of: set, get, rm", action)
+	}
+}